@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -26,7 +27,8 @@ type ICronjobService interface {
 	SearchWithPage(search dto.PageCronjob) (int64, interface{}, error)
 	SearchRecords(search dto.SearchRecord) (int64, interface{}, error)
 	Create(cronjobDto dto.CronjobOperate) error
-	LoadNextHandle(spec string) ([]string, error)
+	LoadNextHandle(spec string, timezone string) ([]string, error)
+	DescribeSpec(spec, timezone, lang string) (string, error)
 	HandleOnce(id uint) error
 	Update(id uint, req dto.CronjobOperate) error
 	UpdateStatus(id uint, status string) error
@@ -41,6 +43,12 @@ type ICronjobService interface {
 
 	LoadInfo(req dto.OperateByID) (*dto.CronjobOperate, error)
 	LoadRecordLog(req dto.OperateByID) string
+	LoadJobGraph() ([]dto.JobGraphNode, error)
+	LoadRunningJobs() []dto.RunningJob
+	CancelRunningJob(cronjobID uint) error
+	SearchNotifications(search dto.SearchNotifyRecord) (int64, interface{}, error)
+	StreamRecordLog(ctx context.Context, recordID uint, fromSeq int64) (chan dto.LogLine, error)
+	LoadRecordLogPage(recordID uint, offset, limit int, grep string) ([]dto.LogLine, error)
 }
 
 func NewICronjobService() ICronjobService {
@@ -112,27 +120,33 @@ func (u *CronjobService) Export(req dto.OperateByIDs) (string, error) {
 	var data []dto.CronjobTrans
 	for _, cronjob := range cronjobs {
 		item := dto.CronjobTrans{
-			Name:           cronjob.Name,
-			Type:           cronjob.Type,
-			SpecCustom:     cronjob.SpecCustom,
-			Spec:           cronjob.Spec,
-			Executor:       cronjob.Executor,
-			ScriptMode:     cronjob.ScriptMode,
-			Script:         cronjob.Script,
-			Command:        cronjob.Command,
-			ContainerName:  cronjob.ContainerName,
-			User:           cronjob.User,
-			URL:            cronjob.URL,
-			DBType:         cronjob.DBType,
-			ExclusionRules: cronjob.ExclusionRules,
-			IsDir:          cronjob.IsDir,
-			SourceDir:      cronjob.SourceDir,
-			RetainCopies:   cronjob.RetainCopies,
-			RetryTimes:     cronjob.RetryTimes,
-			Timeout:        cronjob.Timeout,
-			IgnoreErr:      cronjob.IgnoreErr,
-			Secret:         cronjob.Secret,
-			SnapshotRule:   cronjob.SnapshotRule,
+			Name:             cronjob.Name,
+			Type:             cronjob.Type,
+			SpecCustom:       cronjob.SpecCustom,
+			Spec:             cronjob.Spec,
+			Executor:         cronjob.Executor,
+			ScriptMode:       cronjob.ScriptMode,
+			Script:           cronjob.Script,
+			Command:          cronjob.Command,
+			ContainerName:    cronjob.ContainerName,
+			User:             cronjob.User,
+			URL:              cronjob.URL,
+			DBType:           cronjob.DBType,
+			ExclusionRules:   cronjob.ExclusionRules,
+			IsDir:            cronjob.IsDir,
+			SourceDir:        cronjob.SourceDir,
+			RetainCopies:     cronjob.RetainCopies,
+			RetryTimes:       cronjob.RetryTimes,
+			Timeout:          cronjob.Timeout,
+			IgnoreErr:        cronjob.IgnoreErr,
+			Secret:           cronjob.Secret,
+			SnapshotRule:     cronjob.SnapshotRule,
+			TriggerCondition: cronjob.TriggerCondition,
+		}
+		if cronjob.TriggerParentID != 0 {
+			if parent, err := cronjobRepo.Get(repo.WithByID(cronjob.TriggerParentID)); err == nil && parent.ID != 0 {
+				item.TriggerParentName = parent.Name
+			}
 		}
 		switch cronjob.Type {
 		case "app":
@@ -179,33 +193,38 @@ func (u *CronjobService) Export(req dto.OperateByIDs) (string, error) {
 }
 
 func (u *CronjobService) Import(req []dto.CronjobTrans) error {
+	pendingTriggers := make(map[string]string)
 	for _, item := range req {
 		cronjobItem, _ := cronjobRepo.Get(repo.WithByName(item.Name))
 		if cronjobItem.ID != 0 {
 			continue
 		}
 		cronjob := model.Cronjob{
-			Name:           item.Name,
-			Type:           item.Type,
-			SpecCustom:     item.SpecCustom,
-			Spec:           item.Spec,
-			Executor:       item.Executor,
-			ScriptMode:     item.ScriptMode,
-			Script:         item.Script,
-			Command:        item.Command,
-			ContainerName:  item.ContainerName,
-			User:           item.User,
-			URL:            item.URL,
-			DBType:         item.DBType,
-			ExclusionRules: item.ExclusionRules,
-			IsDir:          item.IsDir,
-			SourceDir:      item.SourceDir,
-			RetainCopies:   item.RetainCopies,
-			RetryTimes:     item.RetryTimes,
-			Timeout:        item.Timeout,
-			IgnoreErr:      item.IgnoreErr,
-			Secret:         item.Secret,
-			SnapshotRule:   item.SnapshotRule,
+			Name:             item.Name,
+			Type:             item.Type,
+			SpecCustom:       item.SpecCustom,
+			Spec:             item.Spec,
+			Executor:         item.Executor,
+			ScriptMode:       item.ScriptMode,
+			Script:           item.Script,
+			Command:          item.Command,
+			ContainerName:    item.ContainerName,
+			User:             item.User,
+			URL:              item.URL,
+			DBType:           item.DBType,
+			ExclusionRules:   item.ExclusionRules,
+			IsDir:            item.IsDir,
+			SourceDir:        item.SourceDir,
+			RetainCopies:     item.RetainCopies,
+			RetryTimes:       item.RetryTimes,
+			Timeout:          item.Timeout,
+			IgnoreErr:        item.IgnoreErr,
+			Secret:           item.Secret,
+			SnapshotRule:     item.SnapshotRule,
+			TriggerCondition: item.TriggerCondition,
+		}
+		if len(item.TriggerParentName) != 0 {
+			pendingTriggers[item.Name] = item.TriggerParentName
 		}
 		hasNotFound := false
 		switch item.Type {
@@ -297,6 +316,18 @@ func (u *CronjobService) Import(req []dto.CronjobTrans) error {
 		}
 		_ = cronjobRepo.Create(&cronjob)
 	}
+	for childName, parentName := range pendingTriggers {
+		child, err := cronjobRepo.Get(repo.WithByName(childName))
+		if err != nil || child.ID == 0 {
+			continue
+		}
+		parent, err := cronjobRepo.Get(repo.WithByName(parentName))
+		if err != nil || parent.ID == 0 {
+			global.LOG.Warnf("trigger parent %s for imported job %s not found, leaving unlinked", parentName, childName)
+			continue
+		}
+		_ = cronjobRepo.Update(child.ID, map[string]interface{}{"trigger_parent_id": parent.ID})
+	}
 	return nil
 }
 
@@ -344,30 +375,22 @@ func (u *CronjobService) SearchRecords(search dto.SearchRecord) (int64, interfac
 	return total, dtoCronjobs, err
 }
 
-func (u *CronjobService) LoadNextHandle(specStr string) ([]string, error) {
-	spec := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+func (u *CronjobService) LoadNextHandle(specStr string, timezone string) ([]string, error) {
 	now := time.Now()
 	var nexts [5]string
 	if strings.HasPrefix(specStr, "@every ") {
-		duration := time.Minute
-		if strings.HasSuffix(specStr, "s") {
-			duration = time.Second
-		}
-		interval := strings.ReplaceAll(specStr, "@every ", "")
-		interval = strings.ReplaceAll(interval, "s", "")
-		interval = strings.ReplaceAll(interval, "m", "")
-		durationItem, err := strconv.Atoi(interval)
+		interval, err := parseEveryDuration(specStr)
 		if err != nil {
 			return nil, err
 		}
 		for i := 0; i < 5; i++ {
-			nextTime := now.Add(time.Duration(durationItem) * duration)
+			nextTime := now.Add(interval)
 			nexts[i] = nextTime.Format(constant.DateTimeLayout)
 			now = nextTime
 		}
 		return nexts[:], nil
 	}
-	sched, err := spec.Parse(specStr)
+	sched, err := parseCronSpec(specStr, timezone)
 	if err != nil {
 		return nil, err
 	}
@@ -379,19 +402,15 @@ func (u *CronjobService) LoadNextHandle(specStr string) ([]string, error) {
 	return nexts[:], nil
 }
 
+// LoadRecordLog returns the full historical log for a record as plain text.
+// For large logs prefer LoadRecordLogPage (paginated) or StreamRecordLog
+// (live tail) instead, since this reads the whole file into memory.
 func (u *CronjobService) LoadRecordLog(req dto.OperateByID) string {
 	record, err := cronjobRepo.GetRecord(repo.WithByID(req.ID))
 	if err != nil {
 		return ""
 	}
-	if _, err := os.Stat(record.Records); err != nil {
-		return ""
-	}
-	content, err := os.ReadFile(record.Records)
-	if err != nil {
-		return ""
-	}
-	return string(content)
+	return loadRecordLogText(record.Records)
 }
 
 func (u *CronjobService) CleanRecord(req dto.CronjobClean) error {
@@ -469,7 +488,7 @@ func (u *CronjobService) HandleOnce(id uint) error {
 	if cronjob.ID == 0 {
 		return buserr.New("ErrRecordNotFound")
 	}
-	u.HandleJob(&cronjob)
+	u.HandleJob(&cronjob, 0)
 	return nil
 }
 
@@ -489,6 +508,13 @@ func (u *CronjobService) Create(req dto.CronjobOperate) error {
 		}
 		cronjob.SnapshotRule = string(rule)
 	}
+	if len(req.NotifyChannels) != 0 {
+		channels, err := json.Marshal(req.NotifyChannels)
+		if err != nil {
+			return err
+		}
+		cronjob.NotifyChannels = string(channels)
+	}
 	if cronjob.Type == "cutWebsiteLog" {
 		backupAccount, err := backupRepo.Get(repo.WithByType(constant.Local))
 		if backupAccount.ID == 0 {
@@ -496,6 +522,18 @@ func (u *CronjobService) Create(req dto.CronjobOperate) error {
 		}
 		cronjob.DownloadAccountID, cronjob.SourceAccountIDs = backupAccount.ID, fmt.Sprintf("%v", backupAccount.ID)
 	}
+	if cronjob.TriggerParentID != 0 {
+		if err := u.checkTriggerCycle(0, cronjob.TriggerParentID); err != nil {
+			return err
+		}
+	}
+	if len(cronjob.Spec) != 0 {
+		for _, spec := range strings.Split(cronjob.Spec, ",") {
+			if err := u.ValidateSpec(spec, cronjob.Timezone); err != nil {
+				return err
+			}
+		}
+	}
 	cronjob.Status = constant.StatusEnable
 
 	global.LOG.Infof("create cronjob %s successful, spec: %s", cronjob.Name, cronjob.Spec)
@@ -544,9 +582,80 @@ func (u *CronjobService) StartJob(cronjob *model.Cronjob, isUpdate bool) (string
 		}
 		ids = append(ids, fmt.Sprintf("%v", entryID))
 	}
+	if hasBackup(cronjob.Type) && cronjob.RetentionMode != constant.RetentionModeClient && len(cronjob.RetentionMode) != 0 {
+		if err := u.applyRetentionPolicy(cronjob); err != nil {
+			return "", err
+		}
+	}
 	return strings.Join(ids, ","), nil
 }
 
+// clientSidePruneEnabled reports whether the automatic, per-run
+// RetainCopies/removeExpiredBackup pruning that runs locally on the panel
+// should apply to cronjob. "server" mode means pruning is the remote
+// lifecycle rule's job alone (see applyRetentionPolicy), so it must not also
+// prune locally - otherwise "server" behaves identically to "hybrid", which
+// is meant to run both. Every other mode, including the empty (legacy)
+// default and "client", keeps pruning locally as before.
+//
+// handleSnapshot's removeExpiredBackup call is the only per-run local-prune
+// call site this guard reaches today. The app/website/database/directory/log
+// backup types are dispatched through u.HandleBackup, whose implementation
+// isn't part of this package in this checkout; if/when its body is found, any
+// removeExpiredBackup call there needs the same gate, or "server" mode keeps
+// double-pruning locally for those types.
+func clientSidePruneEnabled(cronjob *model.Cronjob) bool {
+	return cronjob.RetentionMode != constant.RetentionModeServer
+}
+
+// applyRetentionPolicy pushes the cronjob's RetainCopies/RetainDays down to every
+// non-local source account as a remote lifecycle rule, so pruning keeps working even
+// when the panel itself is offline.
+func (u *CronjobService) applyRetentionPolicy(cronjob *model.Cronjob) error {
+	for _, id := range strings.Split(cronjob.SourceAccountIDs, ",") {
+		idItem, err := strconv.Atoi(id)
+		if err != nil {
+			continue
+		}
+		account, client, err := NewBackupClientWithID(uint(idItem))
+		if err != nil {
+			return err
+		}
+		if account.Type == constant.Local {
+			continue
+		}
+		if err := client.EnsureRetentionPolicy(account, cronjob); err != nil {
+			return fmt.Errorf("set remote retention policy on %s failed, err: %v", account.Name, err)
+		}
+	}
+	return nil
+}
+
+// removeRetentionPolicy tears down any lifecycle rule previously installed by
+// applyRetentionPolicy. Failures are logged rather than returned so a stale or
+// already-removed remote account never blocks deleting the cronjob itself.
+func (u *CronjobService) removeRetentionPolicy(cronjob *model.Cronjob) {
+	if !hasBackup(cronjob.Type) || cronjob.RetentionMode == constant.RetentionModeClient || len(cronjob.RetentionMode) == 0 {
+		return
+	}
+	for _, id := range strings.Split(cronjob.SourceAccountIDs, ",") {
+		idItem, err := strconv.Atoi(id)
+		if err != nil {
+			continue
+		}
+		account, client, err := NewBackupClientWithID(uint(idItem))
+		if err != nil {
+			continue
+		}
+		if account.Type == constant.Local {
+			continue
+		}
+		if err := client.RemoveRetentionPolicy(account, cronjob); err != nil {
+			global.LOG.Errorf("remove remote retention policy on %s failed, err: %v", account.Name, err)
+		}
+	}
+}
+
 func (u *CronjobService) Delete(req dto.CronjobBatchDelete) error {
 	for _, id := range req.IDs {
 		cronjob, _ := cronjobRepo.Get(repo.WithByID(id))
@@ -560,6 +669,7 @@ func (u *CronjobService) Delete(req dto.CronjobBatchDelete) error {
 			global.Cron.Remove(cron.EntryID(idItem))
 		}
 		global.LOG.Infof("stop cronjob entryID: %s", cronjob.EntryIDs)
+		u.removeRetentionPolicy(&cronjob)
 		if err := u.CleanRecord(dto.CronjobClean{CronjobID: id, CleanData: req.CleanData, CleanRemoteData: req.CleanRemoteData, IsDelete: true}); err != nil {
 			return err
 		}
@@ -587,10 +697,29 @@ func (u *CronjobService) Update(id uint, req dto.CronjobOperate) error {
 		}
 		cronjob.SnapshotRule = string(itemRule)
 	}
+	if len(req.NotifyChannels) != 0 {
+		itemChannels, err := json.Marshal(req.NotifyChannels)
+		if err != nil {
+			return err
+		}
+		cronjob.NotifyChannels = string(itemChannels)
+	}
 	cronModel, err := cronjobRepo.Get(repo.WithByID(id))
 	if err != nil {
 		return buserr.New("ErrRecordNotFound")
 	}
+	if req.TriggerParentID != 0 {
+		if err := u.checkTriggerCycle(cronModel.ID, req.TriggerParentID); err != nil {
+			return err
+		}
+	}
+	if len(cronjob.Spec) != 0 {
+		for _, spec := range strings.Split(cronjob.Spec, ",") {
+			if err := u.ValidateSpec(spec, cronjob.Timezone); err != nil {
+				return err
+			}
+		}
+	}
 	upMap := make(map[string]interface{})
 	cronjob.EntryIDs = cronModel.EntryIDs
 	cronjob.Type = cronModel.Type
@@ -632,6 +761,10 @@ func (u *CronjobService) Update(id uint, req dto.CronjobOperate) error {
 	upMap["is_dir"] = req.IsDir
 	upMap["source_dir"] = req.SourceDir
 	upMap["snapshot_rule"] = cronjob.SnapshotRule
+	upMap["notify_channels"] = cronjob.NotifyChannels
+	upMap["ntp_servers"] = req.NtpServers
+	upMap["apply_drift"] = req.ApplyDrift
+	upMap["timezone"] = req.Timezone
 
 	upMap["source_account_ids"] = req.SourceAccountIDs
 	upMap["download_account_id"] = req.DownloadAccountID
@@ -640,6 +773,10 @@ func (u *CronjobService) Update(id uint, req dto.CronjobOperate) error {
 	upMap["timeout"] = req.Timeout
 	upMap["ignore_err"] = req.IgnoreErr
 	upMap["secret"] = req.Secret
+	upMap["retention_mode"] = req.RetentionMode
+	upMap["trigger_parent_id"] = req.TriggerParentID
+	upMap["trigger_condition"] = req.TriggerCondition
+	upMap["concurrency"] = req.Concurrency
 	err = cronjobRepo.Update(id, upMap)
 	if err != nil {
 		return err
@@ -685,14 +822,59 @@ func (u *CronjobService) UpdateStatus(id uint, status string) error {
 }
 
 func (u *CronjobService) AddCronJob(cronjob *model.Cronjob) (int, error) {
-	addFunc := func() {
-		u.HandleJob(cronjob)
+	if len(cronjob.Spec) == 0 && cronjob.TriggerParentID != 0 {
+		global.LOG.Infof("job %s is event-triggered only (parent %d), skip scheduling", cronjob.Name, cronjob.TriggerParentID)
+		return 0, nil
 	}
-	global.LOG.Infof("add %s job %s successful", cronjob.Type, cronjob.Name)
-	entryID, err := global.Cron.AddFunc(cronjob.Spec, addFunc)
+	sched, err := parseCronSpec(cronjob.Spec, cronjob.Timezone)
 	if err != nil {
 		return 0, err
 	}
+	addFunc := func() {
+		u.HandleJob(cronjob, 0)
+	}
+	global.LOG.Infof("add %s job %s successful", cronjob.Type, cronjob.Name)
+	entryID := global.Cron.Schedule(sched, cron.FuncJob(addFunc))
 	global.LOG.Infof("start cronjob entryID: %d", entryID)
 	return int(entryID), nil
 }
+
+// checkTriggerCycle walks the TriggerParentID chain starting at parentID and
+// fails if it ever reaches selfID, which would turn the job DAG into a cycle.
+func (u *CronjobService) checkTriggerCycle(selfID, parentID uint) error {
+	visited := map[uint]bool{}
+	for parentID != 0 {
+		if parentID == selfID {
+			return buserr.New("ErrCronjobTriggerCycle")
+		}
+		if visited[parentID] {
+			break
+		}
+		visited[parentID] = true
+		parent, err := cronjobRepo.Get(repo.WithByID(parentID))
+		if err != nil || parent.ID == 0 {
+			break
+		}
+		parentID = parent.TriggerParentID
+	}
+	return nil
+}
+
+// LoadJobGraph returns every cronjob as an adjacency-list node so the UI can
+// render the full chain (on_success/on_failure/always) graph.
+func (u *CronjobService) LoadJobGraph() ([]dto.JobGraphNode, error) {
+	cronjobs, err := cronjobRepo.List()
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]dto.JobGraphNode, 0, len(cronjobs))
+	for _, cronjob := range cronjobs {
+		nodes = append(nodes, dto.JobGraphNode{
+			ID:               cronjob.ID,
+			Name:             cronjob.Name,
+			TriggerParentID:  cronjob.TriggerParentID,
+			TriggerCondition: cronjob.TriggerCondition,
+		})
+	}
+	return nodes, nil
+}
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/1Panel-dev/1Panel/agent/app/dto"
+	"github.com/1Panel-dev/1Panel/agent/app/model"
+	"github.com/1Panel-dev/1Panel/agent/buserr"
+	"github.com/1Panel-dev/1Panel/agent/constant"
+	"github.com/1Panel-dev/1Panel/agent/global"
+)
+
+// runningJob tracks a single in-flight cronjob run so overlapping triggers of
+// the same job can be detected and, depending on Concurrency, skipped, queued
+// behind it, or replaced. Each run gets its own *runningJob; the pointer
+// itself is the ownership token used to clean the map up safely (see
+// HandleJob), since a "replace" run and the run it replaced must never be
+// able to delete each other's entry.
+type runningJob struct {
+	CronjobID uint
+	StartTime time.Time
+	PID       atomic.Int32 // 0 until setRunningJobPID records a real subprocess PID
+	Cancel    context.CancelFunc
+}
+
+var (
+	// runningJobs holds the currently executing run, if any, for every cronjob ID.
+	runningJobs sync.Map // map[uint]*runningJob
+	// jobRunLocks holds a 1-buffered channel per cronjob ID used to serialize "queue" runs.
+	jobRunLocks sync.Map // map[uint]chan struct{}
+)
+
+// acquireConcurrencySlot applies a cronjob's Concurrency rule against the
+// currently running job (if any) for cronjobID. It only touches package
+// state (runningJobs/jobRunLocks), so it's kept free of any DB/record
+// concerns and is unit-testable on its own.
+//
+// proceed is false when this run must be abandoned instead of started:
+// "skip" with a run already in flight, or "queue" timing out waiting for the
+// slot. replacedPrev is true when a "replace" run cancelled a previous run.
+// release must be deferred by the caller whenever proceed is true; it is a
+// no-op except for "queue", where it frees the slot for the next waiter.
+func acquireConcurrencySlot(cronjobID uint, concurrency string, timeout time.Duration) (proceed, replacedPrev bool, release func()) {
+	release = func() {}
+	switch concurrency {
+	case "skip":
+		if _, isRunning := runningJobs.Load(cronjobID); isRunning {
+			return false, false, release
+		}
+	case "queue":
+		lockVal, _ := jobRunLocks.LoadOrStore(cronjobID, make(chan struct{}, 1))
+		lock := lockVal.(chan struct{})
+		if timeout <= 0 {
+			timeout = 24 * time.Hour
+		}
+		select {
+		case lock <- struct{}{}:
+			release = func() { <-lock }
+		case <-time.After(timeout):
+			return false, false, release
+		}
+	case "replace":
+		if prev, ok := runningJobs.Load(cronjobID); ok {
+			prev.(*runningJob).Cancel()
+			replacedPrev = true
+		}
+	}
+	return true, replacedPrev, release
+}
+
+// HandleJob runs a single cronjob to completion: it opens a JobRecords entry,
+// dispatches to the type-specific handler, closes the record out with the
+// resulting status, and finally fans out to anything chained off of it.
+// triggerRecordID is 0 for a normal cron/manual run, or the parent's record
+// ID when this run was scheduled by RunChildren.
+func (u *CronjobService) HandleJob(cronjob *model.Cronjob, triggerRecordID uint) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proceed, replacedPrev, release := acquireConcurrencySlot(cronjob.ID, cronjob.Concurrency, time.Duration(cronjob.Timeout)*time.Minute)
+	if !proceed {
+		switch cronjob.Concurrency {
+		case "skip":
+			global.LOG.Infof("cronjob %s is still running, skip this overlapping run", cronjob.Name)
+			u.recordSkippedOverlap(cronjob, triggerRecordID)
+		case "queue":
+			global.LOG.Errorf("cronjob %s timed out waiting for the previous run to finish", cronjob.Name)
+		}
+		return
+	}
+	defer release()
+	if replacedPrev {
+		global.LOG.Infof("cronjob %s is still running, cancelling previous run", cronjob.Name)
+	}
+
+	// thisRun is this invocation's ownership token: only this goroutine's
+	// deferred cleanup may remove it, and only while it's still the entry
+	// stored under cronjob.ID. Without that check, a "replace" run that starts
+	// while an older run's HandleJob is still unwinding would have its brand
+	// new entry deleted by the older run's `defer`, making the job look
+	// finished to LoadRunningJobs/CancelRunningJob while it's still executing.
+	thisRun := &runningJob{CronjobID: cronjob.ID, StartTime: time.Now(), Cancel: cancel}
+	runningJobs.Store(cronjob.ID, thisRun)
+	defer runningJobs.CompareAndDelete(cronjob.ID, thisRun)
+
+	record, err := u.startRecords(cronjob, triggerRecordID)
+	if err != nil {
+		global.LOG.Errorf("start record for cronjob %s failed, err: %v", cronjob.Name, err)
+		return
+	}
+	// beginJobLog opens record's JSONL log file and registers it so handleShell
+	// and HandleBackup can append stdout/stderr lines to it via
+	// jobLogWriterFor as they're produced, instead of each writing its own
+	// ad-hoc plain-text file.
+	beginJobLog(record)
+	defer endJobLog(record.ID)
+
+	var message string
+	var execErr error
+	switch cronjob.Type {
+	case "shell":
+		message, execErr = u.handleShell(ctx, cronjob, record)
+	case "app", "website", "database", "directory", "log":
+		message, execErr = u.HandleBackup(ctx, cronjob, record)
+	case "snapshot":
+		message, execErr = u.handleSnapshot(ctx, cronjob, record)
+	case "ntp":
+		var metric string
+		message, metric, execErr = u.handleNtp(cronjob)
+		record.Metric = metric
+	default:
+		execErr = fmt.Errorf("unsupported cronjob type %s", cronjob.Type)
+	}
+
+	status := constant.StatusSuccess
+	if execErr != nil {
+		status = constant.StatusFailed
+		message = execErr.Error()
+		if ctx.Err() != nil {
+			status = constant.StatusCancel
+			message = "run was cancelled (replaced by a newer trigger or cancelled manually)"
+		}
+	}
+	u.EndRecords(record, status, message)
+
+	u.notifyJobResult(cronjob, record, status)
+	if len(record.Records) != 0 {
+		u.compressFinishedLog(cronjob.ID, record.Records)
+	}
+	u.RunChildren(cronjob.ID, record.ID, status)
+}
+
+// recordSkippedOverlap writes a JobRecords entry for a run that never started
+// because a previous run of the same cronjob was still in progress.
+func (u *CronjobService) recordSkippedOverlap(cronjob *model.Cronjob, triggerRecordID uint) {
+	record, err := u.startRecords(cronjob, triggerRecordID)
+	if err != nil {
+		return
+	}
+	u.EndRecords(record, constant.StatusSkip, "skipped: previous run of this cronjob is still in progress")
+}
+
+// startRecords opens a new JobRecords row for this run and returns it so the
+// caller can thread it through execution and close it out with EndRecords.
+func (u *CronjobService) startRecords(cronjob *model.Cronjob, triggerRecordID uint) (model.JobRecords, error) {
+	record := model.JobRecords{
+		CronjobID:       cronjob.ID,
+		StartTime:       time.Now(),
+		Status:          constant.StatusWaiting,
+		TriggerRecordID: triggerRecordID,
+	}
+	if err := cronjobRepo.CreateRecord(&record); err != nil {
+		return record, err
+	}
+	// Records (the JSONL log path) depends on record.ID, which only exists
+	// once CreateRecord has inserted the row, so it's filled in and persisted
+	// as a second step rather than in the literal above. Without this,
+	// beginJobLog's len(record.Records) == 0 guard always trips and no log
+	// writer is ever created for a real run.
+	record.Records = recordLogPath(cronjob, record.ID)
+	if err := cronjobRepo.UpdateRecord(&record); err != nil {
+		return record, err
+	}
+	return record, nil
+}
+
+// EndRecords persists the final status/message and stop time of a job run.
+func (u *CronjobService) EndRecords(record model.JobRecords, status, message string) {
+	record.Status = status
+	record.Message = message
+	record.EndTime = time.Now()
+	_ = cronjobRepo.UpdateRecord(&record)
+}
+
+// maxConcurrentChildRuns bounds how many RunChildren-triggered child jobs may
+// execute at once across the whole process, so a job with a wide fan-out of
+// children can't flood the system with goroutines all starting at the same
+// instant the way an unbounded dispatch would.
+const maxConcurrentChildRuns = 8
+
+var childRunSlots = make(chan struct{}, maxConcurrentChildRuns)
+
+// RunChildren runs every cronjob chained off parentID whose TriggerCondition
+// matches the parent run's finishing status ("always" always matches),
+// linking each child run back to parentRecordID via JobRecords.TriggerRecordID.
+func (u *CronjobService) RunChildren(parentID, parentRecordID uint, status string) {
+	children, err := cronjobRepo.List(cronjobRepo.WithByTriggerParentID(parentID))
+	if err != nil {
+		return
+	}
+	for i := range children {
+		child := children[i]
+		if child.TriggerCondition != "always" && child.TriggerCondition != status {
+			continue
+		}
+		go func(child model.Cronjob) {
+			childRunSlots <- struct{}{}
+			defer func() { <-childRunSlots }()
+			defer func() {
+				if r := recover(); r != nil {
+					global.LOG.Errorf("child cronjob %s triggered by cronjob %d panicked: %v", child.Name, parentID, r)
+				}
+			}()
+			u.HandleJob(&child, parentRecordID)
+		}(child)
+	}
+}
+
+// LoadRunningJobs returns every cronjob currently executing so the UI can
+// display and offer to cancel active runs.
+func (u *CronjobService) LoadRunningJobs() []dto.RunningJob {
+	var items []dto.RunningJob
+	runningJobs.Range(func(_, value interface{}) bool {
+		job := value.(*runningJob)
+		items = append(items, dto.RunningJob{
+			CronjobID: job.CronjobID,
+			StartTime: job.StartTime.Format(constant.DateTimeLayout),
+			PID:       int(job.PID.Load()),
+		})
+		return true
+	})
+	return items
+}
+
+// CancelRunningJob cancels the in-flight run of the given cronjob, if any.
+// It is the manual counterpart to the automatic "replace" concurrency mode.
+// Cancellation always goes through the run's context, never PID: PID is
+// informational only (see setRunningJobPID).
+func (u *CronjobService) CancelRunningJob(cronjobID uint) error {
+	job, ok := runningJobs.Load(cronjobID)
+	if !ok {
+		return buserr.New("ErrRecordNotFound")
+	}
+	job.(*runningJob).Cancel()
+	return nil
+}
+
+// setRunningJobPID records the OS PID of the subprocess a "shell" run
+// actually spawned, once handleShell has started it, so LoadRunningJobs can
+// surface it for display. It is a no-op if no run of the job is tracked
+// anymore (e.g. it already finished). It does not check which run is
+// tracked: a PID recorded after a "replace" run has started is stored on the
+// newer run's entry.
+func setRunningJobPID(cronjobID uint, pid int) {
+	if job, ok := runningJobs.Load(cronjobID); ok {
+		job.(*runningJob).PID.Store(int32(pid))
+	}
+}
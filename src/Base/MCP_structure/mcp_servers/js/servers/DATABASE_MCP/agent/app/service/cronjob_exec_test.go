@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// storeRunning registers a fake in-flight run for cronjobID and returns a
+// flag that's set once its Cancel is invoked, plus a cleanup func.
+func storeRunning(t *testing.T, cronjobID uint) (cancelled *bool, cleanup func()) {
+	t.Helper()
+	cancelled = new(bool)
+	job := &runningJob{CronjobID: cronjobID, StartTime: time.Now(), Cancel: func() { *cancelled = true }}
+	runningJobs.Store(cronjobID, job)
+	return cancelled, func() { runningJobs.Delete(cronjobID) }
+}
+
+func TestAcquireConcurrencySlotAllowProceedsRegardlessOfRunningState(t *testing.T) {
+	const cronjobID = uint(101)
+	_, cleanup := storeRunning(t, cronjobID)
+	defer cleanup()
+
+	proceed, replacedPrev, release := acquireConcurrencySlot(cronjobID, "", 0)
+	defer release()
+
+	if !proceed {
+		t.Fatal("expected allow mode to proceed even with another run in flight")
+	}
+	if replacedPrev {
+		t.Fatal("allow mode must never cancel a previous run")
+	}
+}
+
+func TestAcquireConcurrencySlotSkipRejectsWhileAnotherRunIsInFlight(t *testing.T) {
+	const cronjobID = uint(102)
+	_, cleanup := storeRunning(t, cronjobID)
+	defer cleanup()
+
+	proceed, _, release := acquireConcurrencySlot(cronjobID, "skip", 0)
+	defer release()
+
+	if proceed {
+		t.Fatal("expected skip mode to reject this run while a previous one is still in flight")
+	}
+}
+
+func TestAcquireConcurrencySlotSkipProceedsWhenNothingIsRunning(t *testing.T) {
+	const cronjobID = uint(103)
+
+	proceed, _, release := acquireConcurrencySlot(cronjobID, "skip", 0)
+	defer release()
+
+	if !proceed {
+		t.Fatal("expected skip mode to proceed when no run is in flight")
+	}
+}
+
+func TestAcquireConcurrencySlotQueueSerializesAndTimesOut(t *testing.T) {
+	const cronjobID = uint(104)
+
+	proceed, _, release := acquireConcurrencySlot(cronjobID, "queue", 50*time.Millisecond)
+	if !proceed {
+		t.Fatal("expected the first queue run to acquire the slot immediately")
+	}
+
+	// The slot is held, so a second run must time out waiting for it.
+	proceed2, _, release2 := acquireConcurrencySlot(cronjobID, "queue", 50*time.Millisecond)
+	defer release2()
+	if proceed2 {
+		t.Fatal("expected a second queue run to time out while the slot is held")
+	}
+
+	// Once released, the next run must be able to acquire it again.
+	release()
+	proceed3, _, release3 := acquireConcurrencySlot(cronjobID, "queue", 50*time.Millisecond)
+	defer release3()
+	if !proceed3 {
+		t.Fatal("expected a queue run to acquire the slot once the previous one released it")
+	}
+}
+
+func TestAcquireConcurrencySlotReplaceCancelsThePreviousRun(t *testing.T) {
+	const cronjobID = uint(105)
+	cancelled, cleanup := storeRunning(t, cronjobID)
+	defer cleanup()
+
+	proceed, replacedPrev, release := acquireConcurrencySlot(cronjobID, "replace", 0)
+	defer release()
+
+	if !proceed {
+		t.Fatal("expected replace mode to always proceed")
+	}
+	if !replacedPrev {
+		t.Fatal("expected replace mode to report that it cancelled a previous run")
+	}
+	if !*cancelled {
+		t.Fatal("expected replace mode to call the previous run's Cancel")
+	}
+}
+
+func TestAcquireConcurrencySlotReplaceWithoutAPreviousRun(t *testing.T) {
+	const cronjobID = uint(106)
+
+	proceed, replacedPrev, release := acquireConcurrencySlot(cronjobID, "replace", 0)
+	defer release()
+
+	if !proceed {
+		t.Fatal("expected replace mode to proceed when nothing was running")
+	}
+	if replacedPrev {
+		t.Fatal("expected replacedPrev to be false when there was no previous run to cancel")
+	}
+}
+
+// TestRunningJobsOwnershipSurvivesReplaceRace reproduces the scenario the
+// "replace" mode race fix targets: an older run's deferred cleanup must not
+// be able to delete a newer run's entry for the same cronjob ID.
+func TestRunningJobsOwnershipSurvivesReplaceRace(t *testing.T) {
+	const cronjobID = uint(107)
+	defer runningJobs.Delete(cronjobID)
+
+	_, oldCancel := context.WithCancel(context.Background())
+	oldRun := &runningJob{CronjobID: cronjobID, StartTime: time.Now(), Cancel: oldCancel}
+	runningJobs.Store(cronjobID, oldRun)
+
+	// A "replace" run starts: it cancels oldRun and installs its own entry.
+	_, newCancel := context.WithCancel(context.Background())
+	newRun := &runningJob{CronjobID: cronjobID, StartTime: time.Now(), Cancel: newCancel}
+	runningJobs.Store(cronjobID, newRun)
+
+	// oldRun's HandleJob goroutine finally unwinds and runs its deferred
+	// cleanup. It must not be able to remove newRun's entry.
+	runningJobs.CompareAndDelete(cronjobID, oldRun)
+
+	v, ok := runningJobs.Load(cronjobID)
+	if !ok {
+		t.Fatal("expected the replacement run's entry to still be present")
+	}
+	if v.(*runningJob) != newRun {
+		t.Fatal("expected the replacement run's entry to be unaffected by the old run's cleanup")
+	}
+}
@@ -0,0 +1,504 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/1Panel-dev/1Panel/agent/app/dto"
+	"github.com/1Panel-dev/1Panel/agent/app/model"
+	"github.com/1Panel-dev/1Panel/agent/app/repo"
+	"github.com/1Panel-dev/1Panel/agent/global"
+)
+
+// maxCronjobLogBytes bounds how much log data a single cronjob may keep on
+// disk across all of its records; once exceeded the oldest records are evicted.
+const maxCronjobLogBytes = 500 * 1024 * 1024
+
+// logLine is one structured entry in a record's JSONL log file.
+type logLine struct {
+	Seq    int64     `json:"seq"`
+	Ts     time.Time `json:"ts"`
+	Stream string    `json:"stream"`
+	Msg    string    `json:"msg"`
+}
+
+// jobLogWriter appends structured log lines to a record's .jsonl file while
+// maintaining a seq->byte-offset .idx sidecar for fast paginated/resumed reads.
+type jobLogWriter struct {
+	mu      sync.Mutex
+	file    *os.File
+	idx     *os.File
+	offset  int64
+	nextSeq int64
+}
+
+// recordLogPath returns the on-disk path for a run's structured JSONL log,
+// mirroring the "task/<type>/<name>" layout already used for a shell
+// cronjob's script directory (see Delete), with one file per record so
+// concurrent/queued runs of the same cronjob never collide.
+func recordLogPath(cronjob *model.Cronjob, recordID uint) string {
+	return path.Join(global.Dir.DataDir, "task", cronjob.Type, cronjob.Name, fmt.Sprintf("%d.jsonl", recordID))
+}
+
+func newJobLogWriter(logPath string) (*jobLogWriter, error) {
+	if err := os.MkdirAll(path.Dir(logPath), os.ModePerm); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := os.OpenFile(logPath+".idx", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &jobLogWriter{file: f, idx: idx}, nil
+}
+
+// Write appends one line for a chunk of stdout/stderr output and records its
+// byte offset in the .idx sidecar so StreamRecordLog/LoadRecordLogPage can
+// seek straight to any seq without scanning the whole file.
+func (w *jobLogWriter) Write(stream, msg string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	line := logLine{Seq: w.nextSeq, Ts: time.Now(), Stream: stream, Msg: msg}
+	raw, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	raw = append(raw, '\n')
+	if _, err := w.file.Write(raw); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w.idx, "%d %d\n", line.Seq, w.offset); err != nil {
+		return err
+	}
+	w.offset += int64(len(raw))
+	w.nextSeq++
+	return nil
+}
+
+func (w *jobLogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_ = w.idx.Close()
+	return w.file.Close()
+}
+
+// activeLogWriters holds the in-flight jobLogWriter for every record that is
+// currently executing, keyed by JobRecords.ID. beginJobLog/endJobLog are the
+// only things that mutate it; handleShell/HandleBackup look a writer up via
+// jobLogWriterFor to append each stdout/stderr chunk as it is produced.
+var activeLogWriters sync.Map // map[uint]*jobLogWriter
+
+// beginJobLog opens record's JSONL log file and registers it so the rest of
+// the run can stream lines into it, returning nil if the file couldn't be
+// opened (execution still proceeds; it just runs without a captured log).
+func beginJobLog(record model.JobRecords) *jobLogWriter {
+	if len(record.Records) == 0 {
+		return nil
+	}
+	w, err := newJobLogWriter(record.Records)
+	if err != nil {
+		global.LOG.Errorf("open log writer for record %d failed, err: %v", record.ID, err)
+		return nil
+	}
+	activeLogWriters.Store(record.ID, w)
+	return w
+}
+
+// jobLogWriterFor returns the open log writer for a currently-running
+// record, if any, so handleShell/HandleBackup can append to it.
+func jobLogWriterFor(recordID uint) (*jobLogWriter, bool) {
+	v, ok := activeLogWriters.Load(recordID)
+	if !ok {
+		return nil, false
+	}
+	return v.(*jobLogWriter), true
+}
+
+// endJobLog closes and deregisters record's log writer once its run finishes.
+func endJobLog(recordID uint) {
+	v, ok := activeLogWriters.LoadAndDelete(recordID)
+	if !ok {
+		return
+	}
+	if err := v.(*jobLogWriter).Close(); err != nil {
+		global.LOG.Errorf("close log writer for record %d failed, err: %v", recordID, err)
+	}
+}
+
+// compressFinishedLog zstd-compresses a completed record's log and removes
+// the uncompressed original, then enforces the cronjob's log-size budget.
+func (u *CronjobService) compressFinishedLog(cronjobID uint, logPath string) {
+	if err := compressFile(logPath); err != nil {
+		global.LOG.Errorf("compress cronjob log %s failed, err: %v", logPath, err)
+	} else {
+		// The .idx sidecar's offsets point into the now-deleted plain file and
+		// are meaningless once the log is zstd-compressed, so drop it rather
+		// than let readers mistake it for a still-valid index.
+		_ = os.Remove(logPath + ".idx")
+	}
+	u.enforceLogBudget(cronjobID)
+}
+
+func compressFile(logPath string) error {
+	src, err := os.Open(logPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(logPath + ".zst")
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	enc, err := zstd.NewWriter(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := enc.ReadFrom(src); err != nil {
+		_ = enc.Close()
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return os.Remove(logPath)
+}
+
+// enforceLogBudget deletes the oldest JobRecords' log files for cronjobID
+// until total log size drops back under maxCronjobLogBytes.
+func (u *CronjobService) enforceLogBudget(cronjobID uint) {
+	records, err := cronjobRepo.ListRecord(cronjobRepo.WithByJobID(int(cronjobID)), repo.WithOrderBy("start_time"))
+	if err != nil {
+		return
+	}
+	var total int64
+	sizes := make([]int64, len(records))
+	for i, record := range records {
+		if info, err := os.Stat(logFilePath(record.Records)); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	for i := 0; total > maxCronjobLogBytes && i < len(records); i++ {
+		_ = os.RemoveAll(logFilePath(records[i].Records))
+		_ = os.RemoveAll(logFilePath(records[i].Records) + ".idx")
+		total -= sizes[i]
+	}
+}
+
+// logFilePath returns the on-disk log path for a record, preferring the
+// zstd-compressed form when the plain JSONL has already been rotated away.
+func logFilePath(base string) string {
+	if _, err := os.Stat(base); err == nil {
+		return base
+	}
+	return base + ".zst"
+}
+
+// compressedLogReader closes both the zstd decoder and the backing file.
+type compressedLogReader struct {
+	*zstd.Decoder
+	file *os.File
+}
+
+func (r *compressedLogReader) Close() error {
+	r.Decoder.Close()
+	return r.file.Close()
+}
+
+// openLogFile opens a record's log file for reading, transparently
+// decompressing it if it was already rotated to zstd.
+func openLogFile(logPath string) (io.ReadCloser, error) {
+	actual := logFilePath(logPath)
+	f, err := os.Open(actual)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(actual, ".zst") {
+		return f, nil
+	}
+	dec, err := zstd.NewReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &compressedLogReader{Decoder: dec, file: f}, nil
+}
+
+// StreamRecordLog returns a channel fed with every log line at or after
+// fromSeq, tailing the file live via fsnotify until the record's log is
+// rotated (signalled by its .zst file appearing), the plain log file is gone,
+// or ctx is cancelled - e.g. by the SSE handler when the client disconnects.
+// Without ctx, a client that stops reading mid-job would leave the tail
+// goroutine (and its open watcher/file handle) blocked on a full channel for
+// as long as the job kept running.
+func (u *CronjobService) StreamRecordLog(ctx context.Context, recordID uint, fromSeq int64) (chan dto.LogLine, error) {
+	record, err := cronjobRepo.GetRecord(repo.WithByID(recordID))
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan dto.LogLine, 64)
+	go u.tailRecordLog(ctx, record.Records, fromSeq, out)
+	return out, nil
+}
+
+func (u *CronjobService) tailRecordLog(ctx context.Context, logPath string, fromSeq int64, out chan dto.LogLine) {
+	defer close(out)
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		global.LOG.Errorf("create log watcher for %s failed, err: %v", logPath, err)
+		return
+	}
+	defer watcher.Close()
+	if err := watcher.Add(path.Dir(logPath)); err != nil {
+		global.LOG.Errorf("watch log dir for %s failed, err: %v", logPath, err)
+		return
+	}
+
+	seq := fromSeq
+	// readFrom loads the .idx sidecar once per call and then seeks straight to
+	// each new line's byte offset, instead of rescanning the data file from
+	// byte 0 for every single seq (which made live tailing of a large, fast
+	// growing log effectively O(n^2)). It reports ok=false if ctx was
+	// cancelled mid-send so the caller can stop instead of blocking forever.
+	readFrom := func() (ok bool) {
+		offsets, err := readLogIndex(logPath)
+		if err != nil || seq >= int64(len(offsets)) {
+			return true
+		}
+		f, err := os.Open(logPath)
+		if err != nil {
+			return true
+		}
+		defer f.Close()
+		for seq < int64(len(offsets)) {
+			if offsets[seq] < 0 {
+				seq++
+				continue
+			}
+			line, ok := readLogLineFrom(f, offsets[seq])
+			if !ok {
+				return true
+			}
+			select {
+			case out <- dto.LogLine{Seq: line.Seq, Ts: line.Ts, Stream: line.Stream, Msg: line.Msg}:
+				seq++
+			case <-ctx.Done():
+				return false
+			}
+		}
+		return true
+	}
+	if !readFrom() {
+		return
+	}
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Name == logPath && (event.Op&fsnotify.Write == fsnotify.Write) {
+				if !readFrom() {
+					return
+				}
+			}
+			if event.Name == logPath+".zst" {
+				return
+			}
+		case <-time.After(30 * time.Second):
+			if _, err := os.Stat(logPath); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// readLogIndex loads logPath's ".idx" sidecar into a slice of byte offsets
+// indexed by seq, so callers can seek straight to any line instead of
+// scanning the data file from the start. It only reflects the plain,
+// not-yet-compressed log: once a record's log is rotated to .zst its .idx is
+// removed (see compressFinishedLog), and callers fall back to a linear scan.
+func readLogIndex(logPath string) ([]int64, error) {
+	f, err := os.Open(logPath + ".idx")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var offsets []int64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		seq, err1 := strconv.ParseInt(fields[0], 10, 64)
+		offset, err2 := strconv.ParseInt(fields[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		for int64(len(offsets)) <= seq {
+			offsets = append(offsets, -1)
+		}
+		offsets[seq] = offset
+	}
+	return offsets, scanner.Err()
+}
+
+// readLogLineFrom seeks f to offset and decodes the JSONL entry starting
+// there. f must be the plain (uncompressed) log file the offset came from.
+func readLogLineFrom(f *os.File, offset int64) (logLine, bool) {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return logLine{}, false
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !scanner.Scan() {
+		return logLine{}, false
+	}
+	var line logLine
+	if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+		return logLine{}, false
+	}
+	return line, true
+}
+
+// loadRecordLogText rebuilds the historical plain-text log for a record by
+// concatenating every JSONL line's Msg field in order, transparently reading
+// through zstd when the record's log has already been rotated.
+func loadRecordLogText(logPath string) string {
+	f, err := openLogFile(logPath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	var sb strings.Builder
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var line logLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			continue
+		}
+		sb.WriteString(line.Msg)
+	}
+	return sb.String()
+}
+
+// LoadRecordLogPage returns a page of historical log lines for a record,
+// optionally filtered with a plain-text grep, without loading the whole file.
+// The unfiltered case is the common one (paging through a live or finished
+// record in the UI) and is served by seeking via the .idx sidecar, so only
+// the requested lines are decoded; the .idx sidecar itself is still read in
+// full on every call. A grep filters on line content, which
+// no index can answer directly, so that case still scans the file once.
+func (u *CronjobService) LoadRecordLogPage(recordID uint, offset, limit int, grep string) ([]dto.LogLine, error) {
+	record, err := cronjobRepo.GetRecord(repo.WithByID(recordID))
+	if err != nil {
+		return nil, err
+	}
+	if len(grep) == 0 {
+		if page, ok := loadRecordLogPageBySeq(record.Records, offset, limit); ok {
+			return page, nil
+		}
+	}
+	return scanRecordLogPage(record.Records, offset, limit, grep)
+}
+
+// loadRecordLogPageBySeq serves unfiltered pagination straight from the .idx
+// sidecar. It only applies to the still-plain (not yet zstd-rotated) log; ok
+// is false when that file or its index isn't available, so the caller can
+// fall back to scanRecordLogPage.
+func loadRecordLogPageBySeq(logPath string, offset, limit int) ([]dto.LogLine, bool) {
+	if _, err := os.Stat(logPath); err != nil {
+		return nil, false
+	}
+	offsets, err := readLogIndex(logPath)
+	if err != nil {
+		return nil, false
+	}
+	if offset >= len(offsets) {
+		return nil, true
+	}
+	end := offset + limit
+	if limit <= 0 || end > len(offsets) {
+		end = len(offsets)
+	}
+
+	f, err := os.Open(logPath)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	page := make([]dto.LogLine, 0, end-offset)
+	for seq := offset; seq < end; seq++ {
+		if offsets[seq] < 0 {
+			continue
+		}
+		line, ok := readLogLineFrom(f, offsets[seq])
+		if !ok {
+			break
+		}
+		page = append(page, dto.LogLine{Seq: line.Seq, Ts: line.Ts, Stream: line.Stream, Msg: line.Msg})
+	}
+	return page, true
+}
+
+// scanRecordLogPage is the fallback for grep-filtered pagination and for logs
+// whose .idx sidecar is gone (already compressed, or predating this format):
+// it scans the whole file once, transparently decompressing zstd-rotated logs.
+func scanRecordLogPage(logPath string, offset, limit int, grep string) ([]dto.LogLine, error) {
+	f, err := openLogFile(logPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var matched []dto.LogLine
+	var seq int64
+	for scanner.Scan() {
+		var line logLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			seq++
+			continue
+		}
+		if len(grep) != 0 && !strings.Contains(line.Msg, grep) {
+			seq++
+			continue
+		}
+		matched = append(matched, dto.LogLine{Seq: seq, Ts: line.Ts, Stream: line.Stream, Msg: line.Msg})
+		seq++
+	}
+	if offset >= len(matched) {
+		return nil, nil
+	}
+	end := offset + limit
+	if end > len(matched) || limit <= 0 {
+		end = len(matched)
+	}
+	return matched[offset:end], nil
+}
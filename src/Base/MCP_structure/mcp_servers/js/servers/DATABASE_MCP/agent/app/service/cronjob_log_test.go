@@ -0,0 +1,58 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/1Panel-dev/1Panel/agent/app/model"
+)
+
+// TestBeginJobLogWritesRecordAndIndexFiles reproduces a real run's log-writer
+// lifecycle end to end: beginJobLog must open a writer at record.Records,
+// Write must append both the .jsonl line and its .idx offset entry, and
+// endJobLog must close both files out. This is the part HandleJob depends on
+// record.Records already being set by startRecords before it calls
+// beginJobLog.
+func TestBeginJobLogWritesRecordAndIndexFiles(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "1.jsonl")
+	record := model.JobRecords{Records: logPath}
+	record.ID = 201
+
+	w := beginJobLog(record)
+	if w == nil {
+		t.Fatal("expected beginJobLog to open a writer when record.Records is set")
+	}
+	if _, ok := jobLogWriterFor(record.ID); !ok {
+		t.Fatal("expected the writer to be registered for the running record")
+	}
+
+	if err := w.Write("stdout", "hello"); err != nil {
+		t.Fatalf("write log line failed, err: %v", err)
+	}
+	endJobLog(record.ID)
+
+	if _, ok := jobLogWriterFor(record.ID); ok {
+		t.Fatal("expected the writer to be deregistered once endJobLog runs")
+	}
+	if _, err := os.Stat(logPath); err != nil {
+		t.Fatalf("expected %s to exist, err: %v", logPath, err)
+	}
+	if _, err := os.Stat(logPath + ".idx"); err != nil {
+		t.Fatalf("expected %s.idx to exist, err: %v", logPath, err)
+	}
+}
+
+// TestBeginJobLogSkipsWhenRecordsUnset guards against the inverse regression:
+// a record whose Records path was never assigned must not engage a writer.
+func TestBeginJobLogSkipsWhenRecordsUnset(t *testing.T) {
+	record := model.JobRecords{}
+	record.ID = 202
+
+	if w := beginJobLog(record); w != nil {
+		t.Fatal("expected beginJobLog to skip when record.Records is empty")
+	}
+	if _, ok := jobLogWriterFor(record.ID); ok {
+		t.Fatal("expected no writer to be registered when record.Records is empty")
+	}
+}
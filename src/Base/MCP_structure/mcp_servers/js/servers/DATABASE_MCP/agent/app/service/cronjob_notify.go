@@ -0,0 +1,216 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/1Panel-dev/1Panel/agent/app/dto"
+	"github.com/1Panel-dev/1Panel/agent/app/model"
+	"github.com/1Panel-dev/1Panel/agent/app/repo"
+	"github.com/1Panel-dev/1Panel/agent/global"
+)
+
+// notifyTemplateData is the context exposed to a NotifyChannel's Go template.
+type notifyTemplateData struct {
+	Cronjob    model.Cronjob
+	Record     model.JobRecords
+	LogTail    string
+	Duration   string
+	BackupURLs []string
+}
+
+// notifyJobResult renders and dispatches every NotifyChannel configured on
+// cronjob that matches the run's final status, persisting each delivery
+// attempt so it can be inspected later via SearchNotifications.
+func (u *CronjobService) notifyJobResult(cronjob *model.Cronjob, record model.JobRecords, status string) {
+	if len(cronjob.NotifyChannels) == 0 {
+		return
+	}
+	var channels []dto.NotifyChannel
+	if err := json.Unmarshal([]byte(cronjob.NotifyChannels), &channels); err != nil {
+		global.LOG.Errorf("parse notify channels for cronjob %s failed, err: %v", cronjob.Name, err)
+		return
+	}
+	data := notifyTemplateData{
+		Cronjob:    *cronjob,
+		Record:     record,
+		LogTail:    loadLogTail(record.ID, 50),
+		Duration:   record.EndTime.Sub(record.StartTime).String(),
+		BackupURLs: strings.Split(record.File, ","),
+	}
+	for _, channel := range channels {
+		if channel.OnStatus != "always" && channel.OnStatus != status {
+			continue
+		}
+		go u.deliverNotification(cronjob, channel, data)
+	}
+}
+
+// deliverNotification renders the channel's template and sends it, retrying
+// up to two more times with exponential backoff before giving up.
+func (u *CronjobService) deliverNotification(cronjob *model.Cronjob, channel dto.NotifyChannel, data notifyTemplateData) {
+	body, err := renderNotifyTemplate(channel.Template, data)
+	if err != nil {
+		u.saveNotifyRecord(cronjob.ID, channel, "failed", err.Error())
+		return
+	}
+
+	backoff := time.Second
+	var sendErr error
+	for attempt := 1; attempt <= 3; attempt++ {
+		sendErr = u.sendNotification(cronjob, channel, body)
+		if sendErr == nil {
+			u.saveNotifyRecord(cronjob.ID, channel, "success", "")
+			break
+		}
+		u.saveNotifyRecord(cronjob.ID, channel, "failed", sendErr.Error())
+		global.LOG.Errorf("send %s notification for cronjob %s failed (attempt %d/3), err: %v", channel.Type, cronjob.Name, attempt, sendErr)
+		if attempt < 3 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+// loadLogTail returns the last maxLines log lines for a record, used to keep
+// notification payloads small even when the underlying log is huge.
+func loadLogTail(recordID uint, maxLines int) string {
+	record, err := cronjobRepo.GetRecord(repo.WithByID(recordID))
+	if err != nil {
+		return ""
+	}
+	full := strings.Split(strings.TrimRight(loadRecordLogText(record.Records), "\n"), "\n")
+	if len(full) > maxLines {
+		full = full[len(full)-maxLines:]
+	}
+	return strings.Join(full, "\n")
+}
+
+func renderNotifyTemplate(tpl string, data notifyTemplateData) (string, error) {
+	t, err := template.New("notify").Parse(tpl)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (u *CronjobService) sendNotification(cronjob *model.Cronjob, channel dto.NotifyChannel, body string) error {
+	switch channel.Type {
+	case "webhook":
+		return postWebhook(channel.Target, body, cronjob.Secret)
+	case "slack", "discord", "feishu", "dingtalk":
+		return postWebhook(channel.Target, body, "")
+	case "telegram":
+		return sendTelegram(channel.Target, body)
+	case "email":
+		return sendNotifyEmail(channel.Target, body)
+	default:
+		return fmt.Errorf("unsupported notify channel type %s", channel.Type)
+	}
+}
+
+// postWebhook POSTs body to target, signing it with secret (when set) via
+// HMAC-SHA256 in the X-Horix-Signature header so receivers can verify origin.
+func postWebhook(target, body, secret string) error {
+	req, err := http.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(secret) != 0 {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		req.Header.Set("X-Horix-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned status %d", target, resp.StatusCode)
+	}
+	return nil
+}
+
+// sendTelegram posts body as a chat message via the Telegram Bot API. A bot
+// token isn't a postable URL the way the other channel types' Target is, so
+// telegram channels configure Target as "<botToken>|<chatID>" and this builds
+// the real https://api.telegram.org/bot<token>/sendMessage call from it,
+// instead of forwarding the raw Target to the generic webhook POST.
+func sendTelegram(target, body string) error {
+	token, chatID, err := parseTelegramTarget(target)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(map[string]string{"chat_id": chatID, "text": body})
+	if err != nil {
+		return err
+	}
+	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", token)
+	req, err := http.NewRequest(http.MethodPost, apiURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("telegram sendMessage returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// parseTelegramTarget splits a telegram NotifyChannel.Target of the form
+// "<botToken>|<chatID>" into its two parts.
+func parseTelegramTarget(target string) (token, chatID string, err error) {
+	parts := strings.SplitN(target, "|", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", "", fmt.Errorf("telegram notify target must be formatted as \"<botToken>|<chatID>\"")
+	}
+	return parts[0], parts[1], nil
+}
+
+func sendNotifyEmail(to, body string) error {
+	return NewISystemService().SendMail(to, "Cronjob notification", body)
+}
+
+// saveNotifyRecord persists a single delivery attempt for later auditing via SearchNotifications.
+func (u *CronjobService) saveNotifyRecord(cronjobID uint, channel dto.NotifyChannel, status, message string) {
+	record := model.NotifyRecord{
+		CronjobID: cronjobID,
+		Type:      channel.Type,
+		Target:    channel.Target,
+		Status:    status,
+		Message:   message,
+		SentAt:    time.Now(),
+	}
+	if err := notifyRecordRepo.Create(&record); err != nil {
+		global.LOG.Errorf("persist notify record for cronjob %d failed, err: %v", cronjobID, err)
+	}
+}
+
+// SearchNotifications returns a paginated, optionally cronjob-scoped history
+// of notification delivery attempts.
+func (u *CronjobService) SearchNotifications(search dto.SearchNotifyRecord) (int64, interface{}, error) {
+	total, records, err := notifyRecordRepo.Page(search.Page, search.PageSize, notifyRecordRepo.WithByCronjobID(search.CronjobID))
+	if err != nil {
+		return 0, nil, err
+	}
+	return total, records, nil
+}
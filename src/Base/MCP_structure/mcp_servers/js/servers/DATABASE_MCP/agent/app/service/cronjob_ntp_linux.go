@@ -0,0 +1,13 @@
+package service
+
+import (
+	"syscall"
+	"time"
+)
+
+// applyClockDrift sets the system clock via settimeofday(2). Linux corrects
+// directly against the measured time, so the server it came from isn't needed.
+func applyClockDrift(_ string, t time.Time) error {
+	tv := syscall.NsecToTimeval(t.UnixNano())
+	return syscall.Settimeofday(&tv)
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !windows
+
+package service
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// applyClockDrift is unsupported outside Linux/Windows; ApplyDrift jobs on
+// such hosts will surface this error instead of silently doing nothing.
+func applyClockDrift(_ string, _ time.Time) error {
+	return fmt.Errorf("applying ntp drift is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// applyClockDrift points w32tm at the server the drift was measured against
+// and forces an immediate resync. /manualpeerlist takes a server
+// hostname/IP, not a timestamp, which is why server (not t) drives the
+// correction; /config alone only rewrites the peer list, so /resync is
+// what actually forces the clock to move.
+func applyClockDrift(server string, _ time.Time) error {
+	if err := exec.Command("w32tm", "/config", fmt.Sprintf("/manualpeerlist:%s", server), "/syncfromflags:manual", "/update").Run(); err != nil {
+		return fmt.Errorf("configure w32tm peer %s failed, err: %v", server, err)
+	}
+	if err := exec.Command("w32tm", "/resync", "/force").Run(); err != nil {
+		return fmt.Errorf("w32tm /resync failed, err: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/1Panel-dev/1Panel/agent/buserr"
+)
+
+// cronSpecParser understands 5-field and 6-field (with leading seconds) specs
+// as well as the @yearly/@monthly/@weekly/@daily/@hourly descriptors and
+// "@every <duration>". @reboot is not a recognised descriptor and is rejected.
+var cronSpecParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// parseCronSpec parses spec and, when timezone is set, evaluates it in that
+// IANA location via the "CRON_TZ=" prefix robfig/cron understands natively.
+func parseCronSpec(spec, timezone string) (cron.Schedule, error) {
+	full := spec
+	if len(timezone) != 0 {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return nil, buserr.WithDetail("ErrCronjobInvalidTimezone", timezone, nil)
+		}
+		full = fmt.Sprintf("CRON_TZ=%s %s", timezone, spec)
+	}
+	sched, err := cronSpecParser.Parse(full)
+	if err != nil {
+		return nil, buserr.WithDetail("ErrCronjobInvalidSpec", err.Error(), nil)
+	}
+	return sched, nil
+}
+
+// parseEveryDuration parses an "@every <duration>" spec's duration using
+// standard Go duration syntax (e.g. "90s", "1h", "1h30m"). ValidateSpec,
+// describeEvery, and LoadNextHandle's @every branch all go through this
+// instead of each hand-rolling (and disagreeing on) their own parsing.
+func parseEveryDuration(spec string) (time.Duration, error) {
+	if !strings.HasPrefix(spec, "@every ") {
+		return 0, fmt.Errorf("not an @every spec: %s", spec)
+	}
+	d, err := time.ParseDuration(strings.TrimPrefix(spec, "@every "))
+	if err != nil {
+		return 0, buserr.WithDetail("ErrCronjobInvalidSpec", spec, nil)
+	}
+	return d, nil
+}
+
+// ValidateSpec is the Create/Update-time guard: it rejects an invalid spec or
+// timezone up front with a precise error instead of failing later inside
+// AddCronJob, where the caller has no good way to surface the problem.
+func (u *CronjobService) ValidateSpec(spec, timezone string) error {
+	if strings.HasPrefix(spec, "@every ") {
+		_, err := parseEveryDuration(spec)
+		return err
+	}
+	_, err := parseCronSpec(spec, timezone)
+	return err
+}
+
+// DescribeSpec renders spec as a short human phrase such as
+// "every Monday at 03:15 (Asia/Tokyo)". Specs that don't match one of the
+// common shapes this renderer understands get a generic "on a custom
+// schedule at HH:MM" phrase; the raw spec is echoed only when the parsed
+// schedule isn't a field-based one.
+func (u *CronjobService) DescribeSpec(spec, timezone, lang string) (string, error) {
+	if strings.HasPrefix(spec, "@every ") {
+		return describeEvery(spec, lang), nil
+	}
+	sched, err := parseCronSpec(spec, timezone)
+	if err != nil {
+		return "", err
+	}
+	specSched, ok := sched.(*cron.SpecSchedule)
+	if !ok {
+		return spec, nil
+	}
+	return describeSpecSchedule(specSched, timezone, lang), nil
+}
+
+func describeEvery(spec, lang string) string {
+	interval, err := parseEveryDuration(spec)
+	if err != nil {
+		return spec
+	}
+	if lang == "zh" {
+		return fmt.Sprintf("每 %s 执行一次", interval)
+	}
+	return fmt.Sprintf("every %s", interval)
+}
+
+const dowBits = 0b1111111       // Sun..Sat
+const monthBits = 0b111111111111 << 1
+const domBits = 0xFFFFFFFE      // days 1..31
+const hourBits = 0xFFFFFF       // hours 0..23
+
+var weekdayNamesEn = [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+var weekdayNamesZh = [7]string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}
+
+// describeSpecSchedule turns a parsed 6-field schedule into prose for the
+// common shapes (hourly/daily/weekly/monthly); anything more exotic (several
+// months, several weekdays, step values, ...) is described generically as
+// "at HH:MM" plus a loose cadence hint.
+func describeSpecSchedule(s *cron.SpecSchedule, timezone, lang string) string {
+	hhmm := fmt.Sprintf("%02d:%02d", firstSetBit(s.Hour, 0, 23), firstSetBit(s.Minute, 0, 59))
+	tzSuffix := ""
+	if len(timezone) != 0 {
+		tzSuffix = fmt.Sprintf(" (%s)", timezone)
+	}
+
+	everyDom := s.Dom&domBits == domBits
+	everyMonth := s.Month&monthBits == monthBits
+	everyDow := s.Dow&dowBits == dowBits
+	everyHour := s.Hour&hourBits == hourBits
+	singleTime := bits.OnesCount64(s.Hour) == 1 && bits.OnesCount64(s.Minute) == 1
+
+	switch {
+	case everyDom && everyMonth && everyDow && everyHour && bits.OnesCount64(s.Minute) == 1:
+		minute := firstSetBit(s.Minute, 0, 59)
+		if lang == "zh" {
+			return fmt.Sprintf("每小时第 %d 分钟执行%s", minute, tzSuffix)
+		}
+		return fmt.Sprintf("every hour at minute %d%s", minute, tzSuffix)
+	case everyDom && everyMonth && everyDow && singleTime:
+		if lang == "zh" {
+			return fmt.Sprintf("每天 %s 执行%s", hhmm, tzSuffix)
+		}
+		return fmt.Sprintf("every day at %s%s", hhmm, tzSuffix)
+	case everyDom && everyMonth && bits.OnesCount64(s.Dow) == 1 && singleTime:
+		weekday := firstSetBit(s.Dow, 0, 6)
+		if lang == "zh" {
+			return fmt.Sprintf("每%s %s 执行%s", weekdayNamesZh[weekday], hhmm, tzSuffix)
+		}
+		return fmt.Sprintf("every %s at %s%s", weekdayNamesEn[weekday], hhmm, tzSuffix)
+	case everyMonth && everyDow && bits.OnesCount64(s.Dom) == 1 && singleTime:
+		day := firstSetBit(s.Dom, 1, 31)
+		if lang == "zh" {
+			return fmt.Sprintf("每月 %d 日 %s 执行%s", day, hhmm, tzSuffix)
+		}
+		return fmt.Sprintf("on day %d of every month at %s%s", day, hhmm, tzSuffix)
+	default:
+		if lang == "zh" {
+			return fmt.Sprintf("按自定义计划于 %s 执行%s", hhmm, tzSuffix)
+		}
+		return fmt.Sprintf("on a custom schedule at %s%s", hhmm, tzSuffix)
+	}
+}
+
+// firstSetBit returns the lowest bit index in [lo, hi] set in mask, or lo
+// when no bit in range is set (which only happens for malformed masks).
+func firstSetBit(mask uint64, lo, hi int) int {
+	for i := lo; i <= hi; i++ {
+		if mask&(1<<uint(i)) != 0 {
+			return i
+		}
+	}
+	return lo
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/beevik/ntp"
+
+	"github.com/1Panel-dev/1Panel/agent/app/model"
+)
+
+// ntpClient is swappable in tests; production code always goes through the real SNTP client.
+var ntpClient interface {
+	Time(host string) (time.Time, error)
+} = realNtpClient{}
+
+type realNtpClient struct{}
+
+func (realNtpClient) Time(host string) (time.Time, error) {
+	return ntp.Time(host)
+}
+
+// ntpDriftMetric is persisted into JobRecords.Metric as JSON for "ntp" jobs.
+type ntpDriftMetric struct {
+	Server  string `json:"server"`
+	DriftMs int64  `json:"driftMs"`
+	Applied bool   `json:"applied"`
+}
+
+// handleNtp queries the configured NTP servers (falling back to the next one
+// on failure), computes the clock drift against the first server that
+// answers, and - when ApplyDrift is set - corrects the local clock.
+func (u *CronjobService) handleNtp(cronjob *model.Cronjob) (string, string, error) {
+	var servers []string
+	if len(cronjob.NtpServers) != 0 {
+		servers = strings.Split(cronjob.NtpServers, ",")
+	} else {
+		servers = []string{"pool.ntp.org"}
+	}
+
+	var lastErr error
+	for _, server := range servers {
+		server = strings.TrimSpace(server)
+		if len(server) == 0 {
+			continue
+		}
+		remoteTime, err := queryNtpTime(server)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		drift := remoteTime.Sub(time.Now())
+		driftMs := drift.Milliseconds()
+		applied := false
+		if cronjob.ApplyDrift {
+			if err := applyClockDrift(server, remoteTime); err != nil {
+				return fmt.Sprintf("drift against %s is %dms, but applying it failed: %v", server, driftMs, err), "", err
+			}
+			applied = true
+		}
+		metric, _ := json.Marshal(ntpDriftMetric{Server: server, DriftMs: driftMs, Applied: applied})
+		message := fmt.Sprintf("ntp drift against %s is %dms", server, driftMs)
+		if applied {
+			message += ", clock corrected"
+		}
+		return message, string(metric), nil
+	}
+	return "", "", fmt.Errorf("no configured ntp server answered, last error: %v", lastErr)
+}
+
+// handleSnapshot produces a full panel snapshot (config + db + selected app
+// data) and uploads it through the cronjob's backup accounts, pruning old
+// copies according to RetainCopies the same way the other backup types do.
+func (u *CronjobService) handleSnapshot(ctx context.Context, cronjob *model.Cronjob, record model.JobRecords) (string, error) {
+	accountMap, err := NewBackupClientMap(strings.Split(cronjob.SourceAccountIDs, ","))
+	if err != nil {
+		return "", err
+	}
+
+	snapPath, err := NewISnapshotService().CreatePanelSnapshot(ctx, cronjob.SnapshotRule)
+	if err != nil {
+		return "", fmt.Errorf("create panel snapshot failed, err: %v", err)
+	}
+
+	for name, accountItem := range accountMap {
+		if _, err := accountItem.Client.Upload(snapPath, path.Base(snapPath)); err != nil {
+			return "", fmt.Errorf("upload snapshot to %s failed, err: %v", name, err)
+		}
+	}
+
+	if cronjob.RetainCopies > 0 && clientSidePruneEnabled(cronjob) {
+		u.removeExpiredBackup(cronjob, accountMap, model.BackupRecord{})
+	}
+	return fmt.Sprintf("panel snapshot %s uploaded to %d account(s)", path.Base(snapPath), len(accountMap)), nil
+}
+
+// queryNtpTime resolves the remote time for an NTP server. The actual SNTP
+// round-trip lives behind a small wrapper so it can be swapped out in tests.
+func queryNtpTime(server string) (time.Time, error) {
+	return ntpClient.Time(server)
+}
+
+// applyClockDrift sets the local system clock to t, measured against server.
+// The implementation is platform-specific: settimeofday(2) on Linux, w32tm
+// (pointed at server, then /resync'd) on Windows.